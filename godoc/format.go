@@ -0,0 +1,198 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package godoc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// RegisterFormat registers render as the renderer ServePage uses when a
+// request negotiates mediaType, overriding any built-in renderer for the
+// same media type. This lets a downstream consumer of godoc's content,
+// such as a wiki front-end built on godoc's vfs, plug in its own
+// representation of a Page — Markdown or Gemini text, say — without
+// godoc itself knowing about it.
+func (p *Presentation) RegisterFormat(mediaType string, render func(io.Writer, Page) error) {
+	p.formatsMu.Lock()
+	defer p.formatsMu.Unlock()
+	if p.formats == nil {
+		p.formats = make(map[string]func(io.Writer, Page) error)
+	}
+	p.formats[mediaType] = render
+}
+
+// format returns the renderer ServePage should use for mediaType: a
+// renderer registered with RegisterFormat if there is one, otherwise one
+// of the built-in application/json or text/plain renderers.
+func (p *Presentation) format(mediaType string) (func(io.Writer, Page) error, bool) {
+	p.formatsMu.Lock()
+	render, ok := p.formats[mediaType]
+	p.formatsMu.Unlock()
+	if ok {
+		return render, true
+	}
+	switch mediaType {
+	case "application/json":
+		return renderJSON, true
+	case "text/plain":
+		return p.renderText, true
+	}
+	return nil, false
+}
+
+// negotiateFormat returns the non-HTML media type ServePage should render
+// r's response as, or "" to render the default HTML page. A "format" query
+// parameter takes precedence over the Accept header, so that a plain link
+// can request an alternate representation without needing to set headers.
+func negotiateFormat(r *http.Request) string {
+	switch f := r.URL.Query().Get("format"); f {
+	case "":
+		// fall through to the Accept header
+	case "json":
+		return "application/json"
+	case "text":
+		return "text/plain"
+	default:
+		return f
+	}
+	return acceptedMediaType(r.Header.Get("Accept"))
+}
+
+// acceptedMediaType returns the first media type listed in an Accept
+// header that isn't a wildcard or an HTML type, ignoring quality values.
+// That's adequate for choosing among the handful of alternate renderers
+// ServePage supports; it is not a general-purpose Accept header parser.
+func acceptedMediaType(accept string) string {
+	for _, part := range strings.Split(accept, ",") {
+		mt := strings.TrimSpace(part)
+		if i := strings.Index(mt, ";"); i >= 0 {
+			mt = mt[:i]
+		}
+		switch {
+		case mt == "", strings.HasSuffix(mt, "/*"), strings.HasSuffix(mt, "/html"):
+			continue
+		}
+		return mt
+	}
+	return ""
+}
+
+// jsonPage is the application/json representation of a Page.
+type jsonPage struct {
+	Title    string        `json:"title"`
+	Subtitle string        `json:"subtitle,omitempty"`
+	Query    string        `json:"query,omitempty"`
+	Version  string        `json:"version"`
+	Body     string        `json:"body"`
+	Sections []jsonSection `json:"sections,omitempty"`
+}
+
+// jsonSection is one heading-delimited section of a Page's Body, decoded
+// from its rendered HTML when that's possible.
+type jsonSection struct {
+	Heading string `json:"heading,omitempty"`
+	Level   int    `json:"level,omitempty"`
+	Text    string `json:"text"`
+}
+
+// renderJSON writes page to w as JSON. Body is included verbatim as
+// rendered HTML and, when it can be parsed, decoded into Sections, so that
+// clients that would rather not embed an HTML parser of their own don't
+// have to.
+func renderJSON(w io.Writer, page Page) error {
+	jp := jsonPage{
+		Title:    page.Title,
+		Subtitle: page.Subtitle,
+		Query:    page.Query,
+		Version:  page.Version,
+		Body:     string(page.Body),
+	}
+	if sections, err := decodeHTMLSections(page.Body); err == nil {
+		jp.Sections = sections
+	}
+	return json.NewEncoder(w).Encode(jp)
+}
+
+// renderText renders page using GodocText, the plain-text counterpart to
+// GodocHTML.
+func (p *Presentation) renderText(w io.Writer, page Page) error {
+	if p.GodocText == nil {
+		return fmt.Errorf("godoc: no text/plain template registered")
+	}
+	return p.GodocText.Execute(w, page)
+}
+
+// decodeHTMLSections parses body as HTML and splits it into sections at
+// each heading element (h1 through h6), collecting the text of everything
+// between one heading and the next. It understands the subset of HTML
+// godoc's own templates produce; arbitrary HTML can still fail to parse,
+// in which case renderJSON falls back to the raw Body.
+func decodeHTMLSections(body []byte) ([]jsonSection, error) {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	var sections []jsonSection
+	cur := &jsonSection{}
+	flush := func() {
+		if cur.Heading != "" || strings.TrimSpace(cur.Text) != "" {
+			cur.Text = strings.TrimSpace(cur.Text)
+			sections = append(sections, *cur)
+		}
+	}
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if level, ok := headingLevel(n.Data); ok {
+				flush()
+				cur = &jsonSection{Heading: textContent(n), Level: level}
+				return
+			}
+		}
+		if n.Type == html.TextNode {
+			cur.Text += n.Data
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	flush()
+
+	return sections, nil
+}
+
+func headingLevel(tag string) (int, bool) {
+	switch tag {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		return int(tag[1] - '0'), true
+	}
+	return 0, false
+}
+
+// textContent returns the concatenated text of n and its descendants.
+func textContent(n *html.Node) string {
+	var buf bytes.Buffer
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			buf.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.TrimSpace(buf.String())
+}
@@ -0,0 +1,119 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package godoc
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+	texttemplate "text/template"
+)
+
+func TestNegotiateFormatQueryParam(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"/pkg/fmt/?format=json", "application/json"},
+		{"/pkg/fmt/?format=text", "text/plain"},
+		{"/pkg/fmt/?format=application/x-custom", "application/x-custom"},
+		{"/pkg/fmt/", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.url, nil)
+		if got := negotiateFormat(req); got != tt.want {
+			t.Errorf("negotiateFormat(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestNegotiateFormatAcceptHeader(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"application/json", "application/json"},
+		{"text/html", ""},
+		{"*/*", ""},
+		{"text/html, application/json;q=0.9", "application/json"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/pkg/fmt/", nil)
+		req.Header.Set("Accept", tt.accept)
+		if got := negotiateFormat(req); got != tt.want {
+			t.Errorf("negotiateFormat with Accept %q = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestServePageJSON(t *testing.T) {
+	p := testPresentation(t)
+	req := httptest.NewRequest("GET", "/pkg/fmt/?format=json", nil)
+	rec := httptest.NewRecorder()
+
+	p.ServePage(rec, req, Page{Title: "fmt", Body: []byte("<h1>Fmt</h1><p>formats stuff</p>")})
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	var jp jsonPage
+	if err := json.Unmarshal(rec.Body.Bytes(), &jp); err != nil {
+		t.Fatalf("unmarshaling response: %v", err)
+	}
+	if jp.Title != "fmt" {
+		t.Errorf("Title = %q, want %q", jp.Title, "fmt")
+	}
+	if len(jp.Sections) != 1 || jp.Sections[0].Heading != "Fmt" {
+		t.Errorf("Sections = %+v, want one section headed %q", jp.Sections, "Fmt")
+	}
+}
+
+func TestServePageText(t *testing.T) {
+	p := testPresentation(t)
+	p.GodocText = texttemplate.Must(texttemplate.New("godocText").Parse("{{.Title}}\n"))
+
+	req := httptest.NewRequest("GET", "/pkg/fmt/?format=text", nil)
+	rec := httptest.NewRecorder()
+	p.ServePage(rec, req, Page{Title: "fmt"})
+
+	if got, want := rec.Body.String(), "fmt\n"; got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+}
+
+func TestRegisterFormat(t *testing.T) {
+	p := testPresentation(t)
+	p.RegisterFormat("text/markdown", func(w io.Writer, page Page) error {
+		_, err := io.WriteString(w, "# "+page.Title)
+		return err
+	})
+
+	req := httptest.NewRequest("GET", "/pkg/fmt/?format=text/markdown", nil)
+	rec := httptest.NewRecorder()
+	p.ServePage(rec, req, Page{Title: "fmt"})
+
+	if got, want := rec.Body.String(), "# fmt"; got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+}
+
+func TestDecodeHTMLSections(t *testing.T) {
+	body := []byte("<h2>Overview</h2><p>intro text</p><h2>Index</h2><p>index text</p>")
+	sections, err := decodeHTMLSections(body)
+	if err != nil {
+		t.Fatalf("decodeHTMLSections: %v", err)
+	}
+	if len(sections) != 2 {
+		t.Fatalf("got %d sections, want 2: %+v", len(sections), sections)
+	}
+	if sections[0].Heading != "Overview" || sections[0].Text != "intro text" {
+		t.Errorf("section 0 = %+v", sections[0])
+	}
+	if sections[1].Heading != "Index" || sections[1].Text != "index text" {
+		t.Errorf("section 1 = %+v", sections[1])
+	}
+}
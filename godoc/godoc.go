@@ -0,0 +1,43 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package godoc
+
+import (
+	"html/template"
+	"io"
+	"sync"
+	texttemplate "text/template"
+)
+
+// Corpus holds the state for serving documentation for a set of Go
+// packages, optionally backed by a search index.
+type Corpus struct {
+	// IndexEnabled reports whether the corpus has a search index
+	// available, so that Presentation can show a search box.
+	IndexEnabled bool
+}
+
+// Presentation generates output from a corpus of Go code.
+type Presentation struct {
+	Corpus *Corpus
+
+	ShowPlayground bool
+
+	GodocHTML *template.Template
+	ErrorHTML *template.Template
+
+	// GodocText is the plain-text counterpart to GodocHTML, used to render
+	// a Page for the text/plain format.
+	GodocText *texttemplate.Template
+
+	// PageCache, if non-nil, lets ServePage skip re-rendering a page whose
+	// ETag it has already seen.
+	PageCache PageCache
+
+	// formats holds renderers registered with RegisterFormat, keyed by
+	// media type.
+	formatsMu sync.Mutex
+	formats   map[string]func(io.Writer, Page) error
+}
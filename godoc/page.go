@@ -5,8 +5,18 @@
 package godoc
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
 	"net/http"
 	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 // Page describes the contents of the top-level godoc webpage.
@@ -24,19 +34,237 @@ type Page struct {
 	Version    string
 }
 
-func (p *Presentation) ServePage(w http.ResponseWriter, page Page) {
+// cachedPage is the fully rendered form of a Page, keyed by its ETag so
+// that a PageCache can tell whether a cached entry is still current.
+type cachedPage struct {
+	etag         string
+	lastModified time.Time
+	body         []byte
+	gzipped      []byte // body, gzip-compressed; nil if compression failed
+}
+
+// PageCache stores the fully rendered bytes of a Page so that repeated
+// requests for unchanged content can skip template execution entirely.
+// Presentation.PageCache, if non-nil, is consulted by ServePage before
+// rendering and updated after.
+type PageCache interface {
+	// Get returns the cached entry for key, if any.
+	Get(key string) (cachedPage, bool)
+	// Set stores entry under key, possibly evicting another entry to make
+	// room for it.
+	Set(key string, entry cachedPage)
+}
+
+// NewLRUPageCache returns a PageCache that keeps at most capacity entries
+// in memory, evicting the least recently used entry to make room for a new
+// one once it is full. A capacity of zero leaves the cache unbounded.
+func NewLRUPageCache(capacity int) PageCache {
+	return &lruPageCache{
+		capacity: capacity,
+		items:    make(map[string]cachedPage),
+		order:    make([]string, 0, capacity),
+	}
+}
+
+// lruPageCache is a simple, mutex-guarded LRU cache of rendered pages. It
+// favors a straightforward implementation over raw performance, since a
+// cache hit still dominates the cost of re-executing a template.
+type lruPageCache struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[string]cachedPage
+	order    []string // most-recently-used key last
+}
+
+func (c *lruPageCache) Get(key string) (cachedPage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.items[key]
+	if !ok {
+		return cachedPage{}, false
+	}
+	c.touch(key)
+	return entry, true
+}
+
+func (c *lruPageCache) Set(key string, entry cachedPage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.items[key]; !exists && len(c.items) >= c.capacity && c.capacity > 0 {
+		oldest := c.order[0]
+		c.order = c.order[1:]
+		delete(c.items, oldest)
+	}
+	c.items[key] = entry
+	c.touch(key)
+}
+
+// touch moves key to the most-recently-used end of c.order, assuming c.mu
+// is already held.
+func (c *lruPageCache) touch(key string) {
+	for i, k := range c.order {
+		if k == key {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+	c.order = append(c.order, key)
+}
+
+func (p *Presentation) ServePage(w http.ResponseWriter, r *http.Request, page Page) {
+	p.servePage(w, r, http.StatusOK, page)
+}
+
+// servePage is ServePage's implementation, parameterized over the status
+// code to write. ServeError uses this directly so that an error Page still
+// gets its ETag, Content-Type, and Content-Encoding headers set before the
+// status line is written, rather than committing a bare WriteHeader first
+// and leaving those headers to be dropped on the floor.
+func (p *Presentation) servePage(w http.ResponseWriter, r *http.Request, status int, page Page) {
 	if page.Tabtitle == "" {
 		page.Tabtitle = page.Title
 	}
 	page.SearchBox = p.Corpus.IndexEnabled
 	page.Playground = p.ShowPlayground
 	page.Version = runtime.Version()
-	applyTemplateToResponseWriter(w, p.GodocHTML, page)
+
+	if mediaType := negotiateFormat(r); mediaType != "" {
+		if render, ok := p.format(mediaType); ok {
+			var buf bytes.Buffer
+			if err := render(&buf, page); err != nil {
+				log.Printf("godoc: rendering %s: %v", mediaType, err)
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", mediaType+"; charset=utf-8")
+			w.WriteHeader(status)
+			w.Write(buf.Bytes())
+			return
+		}
+	}
+
+	etag := pageETag(page)
+
+	var cacheKey string
+	if p.PageCache != nil {
+		cacheKey = pageCacheKey(r)
+		if cached, ok := p.PageCache.Get(cacheKey); ok && cached.etag == etag {
+			serveCachedPage(w, r, status, cached)
+			return
+		}
+	}
+
+	body := applyTemplate(p.GodocHTML, "godocHTML", page)
+	cached := cachedPage{
+		etag:         etag,
+		lastModified: time.Now(),
+		body:         body,
+	}
+	if gzipped, err := gzipBytes(body); err != nil {
+		log.Printf("godoc: gzipping page: %v", err)
+	} else {
+		cached.gzipped = gzipped
+	}
+
+	if cacheKey != "" {
+		p.PageCache.Set(cacheKey, cached)
+	}
+	serveCachedPage(w, r, status, cached)
+}
+
+// serveCachedPage writes the ETag and Last-Modified headers for cached,
+// replies 304 Not Modified if r's conditional headers say the client
+// already has this version, and otherwise writes the (possibly
+// gzip-compressed) body under the given status code.
+func serveCachedPage(w http.ResponseWriter, r *http.Request, status int, cached cachedPage) {
+	w.Header().Set("ETag", cached.etag)
+	w.Header().Set("Last-Modified", cached.lastModified.UTC().Format(http.TimeFormat))
+
+	if isNotModified(r, cached.etag, cached.lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// Set Content-Type explicitly: without it, net/http sniffs the first
+	// bytes written to decide, and for the gzip branch below those bytes
+	// are the gzip magic number, which sniffs as application/x-gzip rather
+	// than the text/html the body actually decompresses to.
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if cached.gzipped != nil && acceptsGzip(r) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Length", strconv.Itoa(len(cached.gzipped)))
+		w.WriteHeader(status)
+		w.Write(cached.gzipped)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(cached.body)))
+	w.WriteHeader(status)
+	w.Write(cached.body)
+}
+
+// isNotModified reports whether r's conditional request headers indicate
+// the client already has the version of the page identified by etag and
+// lastModified. If-None-Match takes precedence over If-Modified-Since, per
+// RFC 7232.
+func isNotModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		return match == etag || match == "*"
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		t, err := http.ParseTime(ims)
+		if err == nil && !lastModified.Truncate(time.Second).After(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		if strings.TrimSpace(enc) == "gzip" {
+			return true
+		}
+	}
+	return false
+}
+
+// pageCacheKey identifies a rendered page by the request that produced it:
+// its URL and the client's Accept-Encoding, since the cached bytes may or
+// may not be gzip-compressed.
+func pageCacheKey(r *http.Request) string {
+	return r.URL.String() + "|" + r.Header.Get("Accept-Encoding")
+}
+
+// pageETag returns a stable, content-addressed ETag for page, derived from
+// its Title, Subtitle, Body, and Version and from pageTemplateVersion. The
+// other fields of Page are not part of the hash.
+func pageETag(page Page) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\x00%d", page.Title, page.Subtitle, page.Body, page.Version, pageTemplateVersion)
+	return `"` + hex.EncodeToString(h.Sum(nil)) + `"`
+}
+
+// pageTemplateVersion should be bumped whenever a change to GodocHTML would
+// change its rendered output for an otherwise identical Page, so that
+// stale ETags and cache entries don't survive a template change.
+const pageTemplateVersion = 1
+
+func gzipBytes(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		zw.Close()
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
 
 func (p *Presentation) ServeError(w http.ResponseWriter, r *http.Request, relpath string, err error) {
-	w.WriteHeader(http.StatusNotFound)
-	p.ServePage(w, Page{
+	p.servePage(w, r, http.StatusNotFound, Page{
 		Title:    "File " + relpath,
 		Subtitle: relpath,
 		Body:     applyTemplate(p.ErrorHTML, "errorHTML", err), // err may contain an absolute path!
@@ -0,0 +1,172 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package godoc
+
+import (
+	"compress/gzip"
+	"errors"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func testPresentation(t *testing.T) *Presentation {
+	t.Helper()
+	return &Presentation{
+		Corpus:    &Corpus{},
+		GodocHTML: template.Must(template.New("godocHTML").Parse("<html><body>{{.Title}}</body></html>")),
+		ErrorHTML: template.Must(template.New("errorHTML").Parse("{{.}}")),
+	}
+}
+
+func TestServePageSetsETagAndContentType(t *testing.T) {
+	p := testPresentation(t)
+	req := httptest.NewRequest("GET", "/pkg/fmt/", nil)
+	rec := httptest.NewRecorder()
+
+	p.ServePage(rec, req, Page{Title: "fmt"})
+
+	if ct := rec.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("Content-Type = %q, want %q", ct, "text/html; charset=utf-8")
+	}
+	if rec.Header().Get("ETag") == "" {
+		t.Errorf("ETag header not set")
+	}
+	if rec.Header().Get("Last-Modified") == "" {
+		t.Errorf("Last-Modified header not set")
+	}
+}
+
+func TestServePageConditionalGet(t *testing.T) {
+	p := testPresentation(t)
+
+	req1 := httptest.NewRequest("GET", "/pkg/fmt/", nil)
+	rec1 := httptest.NewRecorder()
+	p.ServePage(rec1, req1, Page{Title: "fmt"})
+	etag := rec1.Header().Get("ETag")
+	if etag == "" {
+		t.Fatalf("first response had no ETag")
+	}
+
+	req2 := httptest.NewRequest("GET", "/pkg/fmt/", nil)
+	req2.Header.Set("If-None-Match", etag)
+	rec2 := httptest.NewRecorder()
+	p.ServePage(rec2, req2, Page{Title: "fmt"})
+
+	if rec2.Code != http.StatusNotModified {
+		t.Errorf("status = %d, want %d", rec2.Code, http.StatusNotModified)
+	}
+}
+
+func TestServePageGzip(t *testing.T) {
+	p := testPresentation(t)
+
+	req := httptest.NewRequest("GET", "/pkg/fmt/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	p.ServePage(rec, req, Page{Title: "fmt"})
+
+	if enc := rec.Header().Get("Content-Encoding"); enc != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want %q", enc, "gzip")
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("Content-Type = %q, want %q", ct, "text/html; charset=utf-8")
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	body, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("reading gzipped body: %v", err)
+	}
+	if string(body) != "<html><body>fmt</body></html>" {
+		t.Errorf("decompressed body = %q", body)
+	}
+}
+
+func TestServePageUsesPageCache(t *testing.T) {
+	p := testPresentation(t)
+	p.PageCache = NewLRUPageCache(8)
+
+	req := httptest.NewRequest("GET", "/pkg/fmt/", nil)
+	rec1 := httptest.NewRecorder()
+	p.ServePage(rec1, req, Page{Title: "fmt"})
+
+	// Change the template so that, if the second request re-rendered
+	// instead of hitting the cache, the body would differ.
+	p.GodocHTML = template.Must(template.New("godocHTML").Parse("<html><body>different</body></html>"))
+
+	rec2 := httptest.NewRecorder()
+	p.ServePage(rec2, req, Page{Title: "fmt"})
+
+	if rec1.Body.String() != rec2.Body.String() {
+		t.Errorf("cached response body = %q, want %q (same as first response)", rec2.Body.String(), rec1.Body.String())
+	}
+}
+
+func TestServeErrorSetsHeadersAndStatus(t *testing.T) {
+	p := testPresentation(t)
+	req := httptest.NewRequest("GET", "/pkg/nonexistent/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+
+	p.ServeError(rec, req, "nonexistent", errors.New("file does not exist"))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec.Header().Get("ETag") == "" {
+		t.Errorf("ETag header not set")
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("Content-Type = %q, want %q", ct, "text/html; charset=utf-8")
+	}
+	if enc := rec.Header().Get("Content-Encoding"); enc != "gzip" {
+		t.Errorf("Content-Encoding = %q, want %q", enc, "gzip")
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	body, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("reading gzipped body: %v", err)
+	}
+	if !strings.Contains(string(body), "File nonexistent") {
+		t.Errorf("decompressed body = %q, want it to contain %q", body, "File nonexistent")
+	}
+}
+
+func TestServeErrorJSON(t *testing.T) {
+	p := testPresentation(t)
+	req := httptest.NewRequest("GET", "/pkg/nonexistent/?format=json", nil)
+	rec := httptest.NewRecorder()
+
+	p.ServeError(rec, req, "nonexistent", errors.New("file does not exist"))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+		t.Errorf("Content-Type = %q, want %q", ct, "application/json; charset=utf-8")
+	}
+}
+
+func TestPageETagStable(t *testing.T) {
+	page := Page{Title: "fmt", Subtitle: "package fmt", Body: []byte("<p>doc</p>"), Version: "go1.99"}
+	if pageETag(page) != pageETag(page) {
+		t.Errorf("pageETag is not stable for identical pages")
+	}
+
+	other := page
+	other.Body = []byte("<p>different</p>")
+	if pageETag(page) == pageETag(other) {
+		t.Errorf("pageETag did not change when Body changed")
+	}
+}
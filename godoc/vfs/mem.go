@@ -0,0 +1,194 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vfs
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memFS is a minimal in-memory, writable file tree. It backs the upper
+// layer of an OverlayFS and is not meant to be used as a general-purpose
+// FileSystem: paths are always cleaned, absolute, and slash-separated.
+type memFS struct {
+	mu        sync.Mutex
+	nodes     map[string]*memNode // cleaned path -> node, including the root "/"
+	whiteouts map[string]bool     // cleaned path -> whited out
+}
+
+// memNode is a single file or directory in a memFS.
+type memNode struct {
+	name    string
+	isDir   bool
+	data    []byte
+	modTime time.Time
+}
+
+func newMemFS() *memFS {
+	return &memFS{
+		nodes: map[string]*memNode{
+			"/": {name: "/", isDir: true, modTime: time.Now()},
+		},
+		whiteouts: make(map[string]bool),
+	}
+}
+
+func (m *memFS) String() string { return "mem" }
+
+func (m *memFS) Open(p string) (ReadSeekCloser, error) {
+	m.mu.Lock()
+	n, ok := m.nodes[p]
+	m.mu.Unlock()
+	if !ok || n.isDir {
+		return nil, &os.PathError{Op: "open", Path: p, Err: os.ErrNotExist}
+	}
+	return &memFile{Reader: bytes.NewReader(n.data)}, nil
+}
+
+func (m *memFS) Lstat(p string) (os.FileInfo, error) { return m.Stat(p) }
+
+func (m *memFS) Stat(p string) (os.FileInfo, error) {
+	m.mu.Lock()
+	n, ok := m.nodes[p]
+	m.mu.Unlock()
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: p, Err: os.ErrNotExist}
+	}
+	return &memFileInfo{n}, nil
+}
+
+func (m *memFS) ReadDir(p string) ([]os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dir, ok := m.nodes[p]
+	if !ok || !dir.isDir {
+		return nil, &os.PathError{Op: "readdir", Path: p, Err: os.ErrNotExist}
+	}
+	var infos []os.FileInfo
+	for cp, n := range m.nodes {
+		if cp != "/" && path.Dir(cp) == p {
+			infos = append(infos, &memFileInfo{n})
+		}
+	}
+	return infos, nil
+}
+
+// create truncates p to an empty file, creating it if necessary, and
+// returns it open for writing. Unlike a general-purpose file system, memFS
+// does not require p's parent to already exist as one of its own nodes:
+// OverlayFS, the only caller, is responsible for checking the parent
+// exists in either layer before calling create.
+func (m *memFS) create(p string) (io.WriteCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := &memNode{name: path.Base(p), modTime: time.Now()}
+	m.nodes[p] = n
+	return &memFileWriter{fs: m, node: n}, nil
+}
+
+// mkdir creates directory p. As with create, the caller is responsible for
+// checking that p's parent exists in either layer.
+func (m *memFS) mkdir(p string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.nodes[p]; exists {
+		return &os.PathError{Op: "mkdir", Path: p, Err: os.ErrExist}
+	}
+	m.nodes[p] = &memNode{name: path.Base(p), isDir: true, modTime: time.Now()}
+	return nil
+}
+
+// remove deletes p, and every node below it, from the upper layer,
+// reporting whether p was present.
+func (m *memFS) remove(p string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.nodes[p]; !ok {
+		return false
+	}
+	delete(m.nodes, p)
+	for cp := range m.nodes {
+		if strings.HasPrefix(cp, p+"/") {
+			delete(m.nodes, cp)
+		}
+	}
+	return true
+}
+
+// whiteout reports whether p, or an ancestor directory of p, has been
+// recorded as removed from the lower layer: removing a directory hides
+// everything below it, not just the exact path removed.
+func (m *memFS) whiteout(p string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for {
+		if m.whiteouts[p] {
+			return true
+		}
+		if p == "/" {
+			return false
+		}
+		p = path.Dir(p)
+	}
+}
+
+func (m *memFS) setWhiteout(p string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.whiteouts[p] = true
+}
+
+func (m *memFS) clearWhiteout(p string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.whiteouts, p)
+}
+
+// memFile is a read-only handle onto a snapshot of a memNode's contents.
+type memFile struct {
+	*bytes.Reader
+}
+
+func (f *memFile) Close() error { return nil }
+
+// memFileWriter buffers writes to a newly created file, committing them to
+// the owning memFS's node on Close.
+type memFileWriter struct {
+	fs   *memFS
+	node *memNode
+	buf  bytes.Buffer
+}
+
+func (w *memFileWriter) Write(p []byte) (int, error) { return w.buf.Write(p) }
+
+func (w *memFileWriter) Close() error {
+	w.fs.mu.Lock()
+	defer w.fs.mu.Unlock()
+	w.node.data = w.buf.Bytes()
+	w.node.modTime = time.Now()
+	return nil
+}
+
+// memFileInfo implements os.FileInfo for a memNode.
+type memFileInfo struct {
+	n *memNode
+}
+
+func (fi *memFileInfo) Name() string { return fi.n.name }
+func (fi *memFileInfo) Size() int64  { return int64(len(fi.n.data)) }
+func (fi *memFileInfo) Mode() os.FileMode {
+	if fi.n.isDir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+func (fi *memFileInfo) ModTime() time.Time { return fi.n.modTime }
+func (fi *memFileInfo) IsDir() bool        { return fi.n.isDir }
+func (fi *memFileInfo) Sys() interface{}   { return nil }
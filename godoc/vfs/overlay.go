@@ -0,0 +1,195 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vfs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+)
+
+// WritableFileSystem extends FileSystem with the operations needed to
+// create and remove files, for file systems that support mutation.
+type WritableFileSystem interface {
+	FileSystem
+
+	// Create creates the named file, truncating it if it already exists,
+	// and returns it open for writing. The parent directory must already
+	// exist.
+	Create(path string) (io.WriteCloser, error)
+
+	// Mkdir creates the named directory. Its parent must already exist.
+	Mkdir(path string) error
+
+	// Remove removes the named file or directory.
+	Remove(path string) error
+}
+
+// NewOverlayFS returns a WritableFileSystem that serves reads and writes
+// out of an in-memory upper layer, falling through to the read-only lower
+// file system for any path the upper layer does not itself know about.
+// lower, such as a file system returned by zipfs, is never modified:
+// removing a path that exists only in lower records a whiteout in the
+// upper layer so that the path is hidden rather than deleted out from
+// under lower.
+func NewOverlayFS(lower FileSystem) WritableFileSystem {
+	return &OverlayFS{
+		lower: lower,
+		upper: newMemFS(),
+	}
+}
+
+// OverlayFS stacks a writable in-memory layer on top of a read-only
+// FileSystem, such as a zipped stdlib snapshot mounted with zipfs. Reads
+// consult the upper layer first, so that any path written, created, or
+// removed through OverlayFS shadows the corresponding path in lower.
+// ReadDir merges the directory entries of both layers, and ones that have
+// been removed are hidden behind a whiteout rather than deleted from
+// lower.
+type OverlayFS struct {
+	lower FileSystem
+	upper *memFS
+}
+
+var _ WritableFileSystem = (*OverlayFS)(nil)
+
+func (o *OverlayFS) String() string {
+	return fmt.Sprintf("overlay(%s over %s)", o.upper, o.lower)
+}
+
+// RootType returns the root type of the underlying lower file system, since
+// the in-memory upper layer has no root type of its own.
+func (o *OverlayFS) RootType(p string) RootType {
+	return o.lower.RootType(p)
+}
+
+func (o *OverlayFS) Open(p string) (ReadSeekCloser, error) {
+	p = path.Clean(p)
+	if o.upper.whiteout(p) {
+		return nil, &os.PathError{Op: "open", Path: p, Err: os.ErrNotExist}
+	}
+	if f, err := o.upper.Open(p); err == nil {
+		return f, nil
+	}
+	return o.lower.Open(p)
+}
+
+func (o *OverlayFS) Lstat(p string) (os.FileInfo, error) { return o.stat(p, o.lower.Lstat) }
+func (o *OverlayFS) Stat(p string) (os.FileInfo, error)  { return o.stat(p, o.lower.Stat) }
+
+func (o *OverlayFS) stat(p string, lowerStat func(string) (os.FileInfo, error)) (os.FileInfo, error) {
+	p = path.Clean(p)
+	if o.upper.whiteout(p) {
+		return nil, &os.PathError{Op: "stat", Path: p, Err: os.ErrNotExist}
+	}
+	if fi, err := o.upper.Stat(p); err == nil {
+		return fi, nil
+	}
+	return lowerStat(p)
+}
+
+// ReadDir returns the merged, name-deduplicated entries of p in the upper
+// and lower layers, preferring the upper layer's entry for any name
+// present in both, and omitting any name whited out in the upper layer.
+func (o *OverlayFS) ReadDir(p string) ([]os.FileInfo, error) {
+	p = path.Clean(p)
+	if o.upper.whiteout(p) {
+		return nil, &os.PathError{Op: "readdir", Path: p, Err: os.ErrNotExist}
+	}
+
+	merged := make(map[string]os.FileInfo)
+	var foundInLower, foundInUpper bool
+	if infos, err := o.lower.ReadDir(p); err == nil {
+		foundInLower = true
+		for _, fi := range infos {
+			merged[fi.Name()] = fi
+		}
+	}
+	if infos, err := o.upper.ReadDir(p); err == nil {
+		foundInUpper = true
+		for _, fi := range infos {
+			merged[fi.Name()] = fi
+		}
+	}
+	if !foundInLower && !foundInUpper {
+		return nil, &os.PathError{Op: "readdir", Path: p, Err: os.ErrNotExist}
+	}
+	for name := range merged {
+		if o.upper.whiteout(path.Join(p, name)) {
+			delete(merged, name)
+		}
+	}
+
+	infos := make([]os.FileInfo, 0, len(merged))
+	for _, fi := range merged {
+		infos = append(infos, fi)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+// Create creates p in the upper layer, clearing any whiteout recorded for
+// it, and returns it open for writing. The parent directory need only
+// exist in one of the two layers: creating a file under a directory that
+// is only present in lower, such as a package directory served out of a
+// zipped stdlib snapshot, does not require first Mkdir'ing that directory
+// in the upper layer too.
+func (o *OverlayFS) Create(p string) (io.WriteCloser, error) {
+	p = path.Clean(p)
+	if !o.dirExists(path.Dir(p)) {
+		return nil, &os.PathError{Op: "create", Path: p, Err: os.ErrNotExist}
+	}
+	o.upper.clearWhiteout(p)
+	return o.upper.create(p)
+}
+
+// Mkdir creates directory p in the upper layer, clearing any whiteout
+// recorded for it. As with Create, p's parent need only exist in one of
+// the two layers.
+func (o *OverlayFS) Mkdir(p string) error {
+	p = path.Clean(p)
+	if !o.dirExists(path.Dir(p)) {
+		return &os.PathError{Op: "mkdir", Path: p, Err: os.ErrNotExist}
+	}
+	o.upper.clearWhiteout(p)
+	return o.upper.mkdir(p)
+}
+
+// dirExists reports whether p names a directory visible through the
+// overlay: one that is not whited out and is present in the upper layer
+// or, failing that, in lower.
+func (o *OverlayFS) dirExists(p string) bool {
+	if o.upper.whiteout(p) {
+		return false
+	}
+	if fi, err := o.upper.Stat(p); err == nil {
+		return fi.IsDir()
+	}
+	fi, err := o.lower.Stat(p)
+	return err == nil && fi.IsDir()
+}
+
+// Remove removes p. If p exists in the upper layer it is deleted outright;
+// if it also, or only, exists in lower, a whiteout is recorded so that p
+// is hidden from subsequent reads without modifying lower.
+//
+// Removing a directory whites out every path below it too, since
+// memFS.whiteout treats a whiteout on an ancestor as covering its
+// descendants; it does not need to, and does not, enumerate and whiteout
+// each descendant in lower individually.
+func (o *OverlayFS) Remove(p string) error {
+	p = path.Clean(p)
+	existedInUpper := o.upper.remove(p)
+	if _, err := o.lower.Lstat(p); err == nil {
+		o.upper.setWhiteout(p)
+		return nil
+	}
+	if !existedInUpper {
+		return &os.PathError{Op: "remove", Path: p, Err: os.ErrNotExist}
+	}
+	return nil
+}
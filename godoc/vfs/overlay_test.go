@@ -0,0 +1,194 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vfs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// fakeFileInfo is a bare-bones os.FileInfo for fakeFS.
+type fakeFileInfo struct {
+	name  string
+	size  int64
+	isDir bool
+}
+
+func (fi fakeFileInfo) Name() string       { return fi.name }
+func (fi fakeFileInfo) Size() int64        { return fi.size }
+func (fi fakeFileInfo) Mode() os.FileMode  { return 0444 }
+func (fi fakeFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi fakeFileInfo) IsDir() bool        { return fi.isDir }
+func (fi fakeFileInfo) Sys() interface{}   { return nil }
+
+// fakeFS is a trivial, read-only FileSystem backed by a fixed set of file
+// paths, standing in for a real lower layer such as zipfs in these tests.
+type fakeFS struct {
+	files map[string]string // path -> contents
+	dirs  map[string]bool   // path -> is a directory
+}
+
+func newFakeFS(files map[string]string) *fakeFS {
+	dirs := map[string]bool{"/": true}
+	for p := range files {
+		for d := path.Dir(p); d != "/" && !dirs[d]; d = path.Dir(d) {
+			dirs[d] = true
+		}
+		dirs["/"] = true
+	}
+	return &fakeFS{files: files, dirs: dirs}
+}
+
+func (fs *fakeFS) String() string { return "fake" }
+
+func (fs *fakeFS) RootType(p string) RootType { return "" }
+
+// fakeFile adapts a *bytes.Reader to ReadSeekCloser.
+type fakeFile struct {
+	*bytes.Reader
+}
+
+func (fakeFile) Close() error { return nil }
+
+func (fs *fakeFS) Open(p string) (ReadSeekCloser, error) {
+	contents, ok := fs.files[p]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: p, Err: os.ErrNotExist}
+	}
+	return fakeFile{bytes.NewReader([]byte(contents))}, nil
+}
+
+func (fs *fakeFS) Lstat(p string) (os.FileInfo, error) { return fs.Stat(p) }
+
+func (fs *fakeFS) Stat(p string) (os.FileInfo, error) {
+	if fs.dirs[p] {
+		return fakeFileInfo{name: path.Base(p), isDir: true}, nil
+	}
+	if contents, ok := fs.files[p]; ok {
+		return fakeFileInfo{name: path.Base(p), size: int64(len(contents))}, nil
+	}
+	return nil, &os.PathError{Op: "stat", Path: p, Err: os.ErrNotExist}
+}
+
+func (fs *fakeFS) ReadDir(p string) ([]os.FileInfo, error) {
+	if !fs.dirs[p] {
+		return nil, &os.PathError{Op: "readdir", Path: p, Err: os.ErrNotExist}
+	}
+	var infos []os.FileInfo
+	seen := make(map[string]bool)
+	for d := range fs.dirs {
+		if d != "/" && path.Dir(d) == p && !seen[d] {
+			seen[d] = true
+			infos = append(infos, fakeFileInfo{name: path.Base(d), isDir: true})
+		}
+	}
+	for f := range fs.files {
+		if path.Dir(f) == p && !seen[f] {
+			seen[f] = true
+			infos = append(infos, fakeFileInfo{name: path.Base(f), size: int64(len(fs.files[f]))})
+		}
+	}
+	return infos, nil
+}
+
+func TestOverlayCreateUnderLowerOnlyDir(t *testing.T) {
+	lower := newFakeFS(map[string]string{"/pkg/fmt/doc.go": "package fmt"})
+	o := NewOverlayFS(lower)
+
+	w, err := o.Create("/pkg/fmt/generated.html")
+	if err != nil {
+		t.Fatalf("Create under a directory that exists only in the lower layer: %v", err)
+	}
+	if _, err := w.Write([]byte("<html></html>")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := o.Open("/pkg/fmt/generated.html")
+	if err != nil {
+		t.Fatalf("Open after Create: %v", err)
+	}
+	defer f.Close()
+	got, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "<html></html>" {
+		t.Errorf("got contents %q, want %q", got, "<html></html>")
+	}
+}
+
+func TestOverlayMkdirUnderLowerOnlyDir(t *testing.T) {
+	lower := newFakeFS(map[string]string{"/pkg/fmt/doc.go": "package fmt"})
+	o := NewOverlayFS(lower)
+
+	if err := o.Mkdir("/pkg/fmt/cache"); err != nil {
+		t.Fatalf("Mkdir under a directory that exists only in the lower layer: %v", err)
+	}
+	fi, err := o.Stat("/pkg/fmt/cache")
+	if err != nil {
+		t.Fatalf("Stat after Mkdir: %v", err)
+	}
+	if !fi.IsDir() {
+		t.Errorf("Stat(%q).IsDir() = false, want true", "/pkg/fmt/cache")
+	}
+}
+
+func TestOverlayCreateMissingParent(t *testing.T) {
+	lower := newFakeFS(map[string]string{"/pkg/fmt/doc.go": "package fmt"})
+	o := NewOverlayFS(lower)
+
+	if _, err := o.Create("/pkg/nonexistent/generated.html"); err == nil {
+		t.Fatalf("Create under a nonexistent parent unexpectedly succeeded")
+	}
+}
+
+func TestOverlayRemoveHidesDescendants(t *testing.T) {
+	lower := newFakeFS(map[string]string{
+		"/pkg/foo/a.go":   "package foo",
+		"/pkg/foo/sub.go": "package foo",
+	})
+	o := NewOverlayFS(lower)
+
+	if err := o.Remove("/pkg/foo"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+
+	if _, err := o.Open("/pkg/foo/sub.go"); err == nil {
+		t.Errorf("Open(%q) succeeded after removing ancestor directory %q; descendant should be hidden", "/pkg/foo/sub.go", "/pkg/foo")
+	}
+	if _, err := o.Stat("/pkg/foo"); err == nil {
+		t.Errorf("Stat(%q) succeeded after Remove", "/pkg/foo")
+	}
+}
+
+func TestOverlayReadDirMerge(t *testing.T) {
+	lower := newFakeFS(map[string]string{"/foo": "lower foo"})
+	o := NewOverlayFS(lower)
+
+	w, err := o.Create("/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	infos, err := o.ReadDir("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool)
+	for _, fi := range infos {
+		names[fi.Name()] = true
+	}
+	if !names["foo"] || !names["bar"] {
+		t.Errorf("ReadDir(\"/\") = %v, want entries for both foo (lower) and bar (upper)", names)
+	}
+}
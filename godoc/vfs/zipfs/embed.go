@@ -0,0 +1,202 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zipfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/tools/godoc/vfs"
+)
+
+const (
+	eocdSignature      = "PK\x05\x06"
+	eocdFixedSize      = 22 // end-of-central-directory record, excluding the variable-length comment
+	zip64LocatorSig    = "PK\x06\x07"
+	zip64LocatorSize   = 20
+	zip64EOCDSignature = "PK\x06\x06"
+	maxEOCDCommentSize = 1<<16 - 1
+)
+
+// NewFromExecutable returns a vfs.FileSystem serving the contents of a zip
+// archive found in the executable at path, whether that archive is stored
+// in one of the executable's own sections (for a binary built with the
+// archive linked in) or simply appended to the file after its normal
+// contents (for a binary self-extracting archive produced by concatenating
+// `cat binary archive.zip > binary`).
+func NewFromExecutable(path, name string) (vfs.FileSystem, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	fsys, err := NewFromReaderAt(f, fi.Size(), name)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return fsys, nil
+}
+
+// NewFromReaderAt is like NewFromExecutable, but reads the executable from
+// ra, which holds size bytes.
+//
+// It tries three strategies in order: locating a zip archive embedded in
+// one of the executable's ELF, PE, or Mach-O sections; locating a zip
+// archive appended after the executable's own contents; and finally,
+// treating ra itself as a zip archive.
+func NewFromReaderAt(ra io.ReaderAt, size int64, name string) (vfs.FileSystem, error) {
+	if zr, err := zipInSection(ra, size); err == nil {
+		return New(&zip.ReadCloser{Reader: *zr}, name), nil
+	}
+	if zr, err := zipAppended(ra, size); err == nil {
+		return New(&zip.ReadCloser{Reader: *zr}, name), nil
+	}
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return nil, fmt.Errorf("zipfs: no zip archive found in executable: %v", err)
+	}
+	return New(&zip.ReadCloser{Reader: *zr}, name), nil
+}
+
+// section is the file offset and length of a single object-file section,
+// independent of the object file format it came from.
+type section struct {
+	offset, size int64
+}
+
+// zipInSection parses ra as an ELF, PE, or Mach-O object file and returns a
+// zip.Reader over the first non-BSS section that is itself a valid zip
+// archive.
+func zipInSection(ra io.ReaderAt, size int64) (*zip.Reader, error) {
+	scanners := []func(io.ReaderAt) ([]section, error){elfSections, peSections, machoSections}
+	for _, scan := range scanners {
+		sections, err := scan(ra)
+		if err != nil {
+			continue
+		}
+		for _, s := range sections {
+			if s.size == 0 {
+				continue
+			}
+			sr := io.NewSectionReader(ra, s.offset, s.size)
+			if zr, err := zip.NewReader(sr, s.size); err == nil {
+				return zr, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("zipfs: no section contains a valid zip archive")
+}
+
+func elfSections(ra io.ReaderAt) ([]section, error) {
+	f, err := elf.NewFile(ra)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var sections []section
+	for _, s := range f.Sections {
+		if s.Type == elf.SHT_NOBITS { // BSS-like section; has no file content
+			continue
+		}
+		sections = append(sections, section{int64(s.Offset), int64(s.Size)})
+	}
+	return sections, nil
+}
+
+func peSections(ra io.ReaderAt) ([]section, error) {
+	f, err := pe.NewFile(ra)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var sections []section
+	for _, s := range f.Sections {
+		sections = append(sections, section{int64(s.Offset), int64(s.Size)})
+	}
+	return sections, nil
+}
+
+func machoSections(ra io.ReaderAt) ([]section, error) {
+	f, err := macho.NewFile(ra)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var sections []section
+	for _, s := range f.Sections {
+		sections = append(sections, section{int64(s.Offset), int64(s.Size)})
+	}
+	return sections, nil
+}
+
+// zipAppended locates a zip archive appended after an executable's own
+// contents by scanning backward for the end-of-central-directory record,
+// honoring a ZIP64 locator if one precedes it, and computing the start of
+// the archive from the central directory's recorded size and offset.
+func zipAppended(ra io.ReaderAt, size int64) (*zip.Reader, error) {
+	eocdOffset, centralDirSize, centralDirOffset, err := findEOCD(ra, size)
+	if err != nil {
+		return nil, err
+	}
+	base := eocdOffset - centralDirSize - centralDirOffset
+	if base <= 0 || base >= size {
+		return nil, fmt.Errorf("zipfs: computed invalid appended-zip base offset %d", base)
+	}
+	sr := io.NewSectionReader(ra, base, size-base)
+	return zip.NewReader(sr, size-base)
+}
+
+// findEOCD returns the offset of the end-of-central-directory record in ra,
+// along with the central directory size and offset it records, preferring
+// the ZIP64 end-of-central-directory record when a ZIP64 locator is found
+// immediately before the record found first.
+func findEOCD(ra io.ReaderAt, size int64) (eocdOffset, centralDirSize, centralDirOffset int64, err error) {
+	window := int64(eocdFixedSize + maxEOCDCommentSize)
+	if window > size {
+		window = size
+	}
+	buf := make([]byte, window)
+	if _, err := ra.ReadAt(buf, size-window); err != nil && err != io.EOF {
+		return 0, 0, 0, err
+	}
+	idx := bytes.LastIndex(buf, []byte(eocdSignature))
+	if idx < 0 {
+		return 0, 0, 0, fmt.Errorf("zipfs: end-of-central-directory signature not found")
+	}
+	eocdOffset = size - window + int64(idx)
+	if idx+eocdFixedSize > len(buf) {
+		return 0, 0, 0, fmt.Errorf("zipfs: truncated end-of-central-directory record")
+	}
+	rec := buf[idx : idx+eocdFixedSize]
+	centralDirSize = int64(binary.LittleEndian.Uint32(rec[12:16]))
+	centralDirOffset = int64(binary.LittleEndian.Uint32(rec[16:20]))
+
+	if eocdOffset >= zip64LocatorSize {
+		loc := make([]byte, zip64LocatorSize)
+		if _, err := ra.ReadAt(loc, eocdOffset-zip64LocatorSize); err == nil && bytes.Equal(loc[:4], []byte(zip64LocatorSig)) {
+			zip64Offset := int64(binary.LittleEndian.Uint64(loc[8:16]))
+			zip64Rec := make([]byte, 56)
+			if _, err := ra.ReadAt(zip64Rec, zip64Offset); err == nil && bytes.Equal(zip64Rec[:4], []byte(zip64EOCDSignature)) {
+				eocdOffset = zip64Offset
+				centralDirSize = int64(binary.LittleEndian.Uint64(zip64Rec[40:48]))
+				centralDirOffset = int64(binary.LittleEndian.Uint64(zip64Rec[48:56]))
+			}
+		}
+	}
+
+	return eocdOffset, centralDirSize, centralDirOffset, nil
+}
@@ -0,0 +1,261 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zipfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// buildZip returns the bytes of a zip archive containing files.
+func buildZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, contents := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("zw.Create(%q): %v", name, err)
+		}
+		if _, err := io.WriteString(w, contents); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestFindEOCDAppended(t *testing.T) {
+	zipBytes := buildZip(t, map[string]string{"foo": "foo contents"})
+
+	const prefixSize = 4096 // simulate an executable's own contents
+	data := append(make([]byte, prefixSize), zipBytes...)
+	ra := bytes.NewReader(data)
+
+	eocdOffset, centralDirSize, centralDirOffset, err := findEOCD(ra, int64(len(data)))
+	if err != nil {
+		t.Fatalf("findEOCD: %v", err)
+	}
+	base := eocdOffset - centralDirSize - centralDirOffset
+	if base != prefixSize {
+		t.Errorf("findEOCD base = %d, want %d", base, prefixSize)
+	}
+}
+
+func TestZipAppended(t *testing.T) {
+	zipBytes := buildZip(t, map[string]string{"foo": "foo contents", "bar": "bar contents"})
+
+	prefix := []byte("#!/bin/sh\nexec some-launcher \"$0\" \"$@\"\n")
+	data := append(append([]byte{}, prefix...), zipBytes...)
+	ra := bytes.NewReader(data)
+
+	zr, err := zipAppended(ra, int64(len(data)))
+	if err != nil {
+		t.Fatalf("zipAppended: %v", err)
+	}
+	if len(zr.File) != 2 {
+		t.Fatalf("zipAppended: got %d files, want 2", len(zr.File))
+	}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("opening %q: %v", f.Name, err)
+		}
+		got, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]string{"foo": "foo contents", "bar": "bar contents"}[f.Name]
+		if string(got) != want {
+			t.Errorf("file %q contents = %q, want %q", f.Name, got, want)
+		}
+	}
+}
+
+func TestZipAppendedNoZip(t *testing.T) {
+	data := []byte("just a plain executable, no zip appended")
+	if _, err := zipAppended(bytes.NewReader(data), int64(len(data))); err == nil {
+		t.Errorf("zipAppended on a file with no appended zip unexpectedly succeeded")
+	}
+}
+
+// buildELFWithZip returns the bytes of a minimal 64-bit little-endian ELF
+// file holding zipData in a single PROGBITS section, so that zipInSection's
+// elfSections strategy has something real to scan.
+func buildELFWithZip(t *testing.T, zipData []byte) []byte {
+	t.Helper()
+
+	const (
+		ehdrSize = 64
+		shdrSize = 64
+	)
+	shstrtab := []byte("\x00.shstrtab\x00.data\x00")
+	const (
+		shstrtabNameOff = 1
+		dataNameOff     = 11
+	)
+
+	dataOff := int64(ehdrSize)
+	shstrtabOff := dataOff + int64(len(zipData))
+	shoff := shstrtabOff + int64(len(shstrtab))
+
+	var buf bytes.Buffer
+
+	// e_ident
+	ident := make([]byte, 16)
+	copy(ident, "\x7fELF")
+	ident[4] = 2 // ELFCLASS64
+	ident[5] = 1 // ELFDATA2LSB
+	ident[6] = 1 // EV_CURRENT
+	buf.Write(ident)
+
+	write := func(v interface{}) {
+		if err := binary.Write(&buf, binary.LittleEndian, v); err != nil {
+			t.Fatalf("binary.Write: %v", err)
+		}
+	}
+	write(uint16(elf.ET_EXEC))
+	write(uint16(elf.EM_X86_64))
+	write(uint32(elf.EV_CURRENT))
+	write(uint64(0))     // e_entry
+	write(uint64(0))     // e_phoff
+	write(uint64(shoff)) // e_shoff
+	write(uint32(0))     // e_flags
+	write(uint16(ehdrSize))
+	write(uint16(0)) // e_phentsize
+	write(uint16(0)) // e_phnum
+	write(uint16(shdrSize))
+	write(uint16(3)) // e_shnum: null, shstrtab, data
+	write(uint16(1)) // e_shstrndx
+
+	if buf.Len() != ehdrSize {
+		t.Fatalf("ELF header is %d bytes, want %d", buf.Len(), ehdrSize)
+	}
+
+	buf.Write(zipData)
+	buf.Write(shstrtab)
+
+	// Shdr 0: SHT_NULL, all zero.
+	buf.Write(make([]byte, shdrSize))
+
+	writeShdr := func(nameOff, shType uint32, offset, size int64) {
+		write(nameOff)
+		write(shType)
+		write(uint64(0)) // sh_flags
+		write(uint64(0)) // sh_addr
+		write(uint64(offset))
+		write(uint64(size))
+		write(uint32(0)) // sh_link
+		write(uint32(0)) // sh_info
+		write(uint64(0)) // sh_addralign
+		write(uint64(0)) // sh_entsize
+	}
+	writeShdr(shstrtabNameOff, uint32(elf.SHT_STRTAB), shstrtabOff, int64(len(shstrtab)))
+	writeShdr(dataNameOff, uint32(elf.SHT_PROGBITS), dataOff, int64(len(zipData)))
+
+	return buf.Bytes()
+}
+
+func TestZipInSectionELF(t *testing.T) {
+	zipBytes := buildZip(t, map[string]string{"foo": "foo contents"})
+	elfData := buildELFWithZip(t, zipBytes)
+
+	zr, err := zipInSection(bytes.NewReader(elfData), int64(len(elfData)))
+	if err != nil {
+		t.Fatalf("zipInSection: %v", err)
+	}
+	if len(zr.File) != 1 || zr.File[0].Name != "foo" {
+		t.Fatalf("zipInSection: got files %+v, want one file named %q", zr.File, "foo")
+	}
+	rc, err := zr.File[0].Open()
+	if err != nil {
+		t.Fatalf("opening %q: %v", zr.File[0].Name, err)
+	}
+	defer rc.Close()
+	got, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "foo contents" {
+		t.Errorf("contents = %q, want %q", got, "foo contents")
+	}
+}
+
+// TestFindEOCDZip64 builds a hand-rolled end-of-central-directory chain
+// containing a ZIP64 locator and record, and checks that findEOCD prefers
+// the ZIP64 record's central directory size and offset over the regular
+// EOCD record's (placeholder, 0xFFFFFFFF) fields that precede it in the
+// scan order.
+func TestFindEOCDZip64(t *testing.T) {
+	const (
+		prefixSize     = 1000 // simulate an executable's own contents
+		centralDirSize = 777  // simulate the zip's central directory
+	)
+
+	var buf bytes.Buffer
+	buf.Write(make([]byte, prefixSize))     // executable prefix
+	buf.Write(make([]byte, centralDirSize)) // stand-in central directory
+
+	zip64EOCDOffset := int64(buf.Len())
+	zip64Rec := make([]byte, 56)
+	copy(zip64Rec[0:4], zip64EOCDSignature)
+	binary.LittleEndian.PutUint64(zip64Rec[40:48], uint64(centralDirSize))
+	binary.LittleEndian.PutUint64(zip64Rec[48:56], uint64(0)) // central dir offset, relative to the archive base
+	buf.Write(zip64Rec)
+
+	locator := make([]byte, zip64LocatorSize)
+	copy(locator[0:4], zip64LocatorSig)
+	binary.LittleEndian.PutUint64(locator[8:16], uint64(zip64EOCDOffset))
+	buf.Write(locator)
+
+	eocd := make([]byte, eocdFixedSize)
+	copy(eocd[0:4], eocdSignature)
+	binary.LittleEndian.PutUint32(eocd[12:16], 0xFFFFFFFF) // placeholder, superseded by the ZIP64 record
+	binary.LittleEndian.PutUint32(eocd[16:20], 0xFFFFFFFF)
+	buf.Write(eocd)
+
+	data := buf.Bytes()
+	eocdOffset, gotCentralDirSize, gotCentralDirOffset, err := findEOCD(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("findEOCD: %v", err)
+	}
+	if gotCentralDirSize != centralDirSize {
+		t.Errorf("centralDirSize = %d, want %d (the ZIP64 record's, not the regular EOCD's)", gotCentralDirSize, centralDirSize)
+	}
+	base := eocdOffset - gotCentralDirSize - gotCentralDirOffset
+	if base != prefixSize {
+		t.Errorf("findEOCD base = %d, want %d", base, prefixSize)
+	}
+}
+
+func TestNewFromReaderAtAppended(t *testing.T) {
+	zipBytes := buildZip(t, map[string]string{"foo": "foo contents"})
+	data := append(make([]byte, 1024), zipBytes...)
+
+	fsys, err := NewFromReaderAt(bytes.NewReader(data), int64(len(data)), "test")
+	if err != nil {
+		t.Fatalf("NewFromReaderAt: %v", err)
+	}
+	f, err := fsys.Open("/foo")
+	if err != nil {
+		t.Fatalf("Open(/foo): %v", err)
+	}
+	defer f.Close()
+	got, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "foo contents" {
+		t.Errorf("contents = %q, want %q", got, "foo contents")
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zipfs
+
+import (
+	"archive/zip"
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"golang.org/x/tools/godoc/vfs"
+)
+
+// defaultChunkSize is the size, in bytes, of the Range requests issued by a
+// rangeReaderAt when it misses its cache. The zip central directory scan
+// that happens on open reads the file in small, scattered pieces, so a
+// chunk noticeably larger than any one of those reads amortizes the
+// round-trip cost across the HTTP requests that follow.
+const defaultChunkSize = 4 << 20 // 4 MiB
+
+// defaultCacheChunks is the number of chunks kept in the LRU cache used by
+// NewFromURL. At the default chunk size this bounds cache memory to 64 MiB.
+const defaultCacheChunks = 16
+
+// NewFromURL returns a vfs.FileSystem serving the contents of the zip
+// archive at url without downloading it in full. It issues a HEAD request
+// to learn the archive's size and confirm the server supports byte range
+// requests, then serves the central directory scan and subsequent file
+// reads via HTTP Range requests over rangeReaderAt, an io.ReaderAt that
+// caches recently fetched chunks in memory.
+//
+// client may be nil, in which case http.DefaultClient is used.
+func NewFromURL(ctx context.Context, client *http.Client, url, name string) (vfs.FileSystem, error) {
+	return newFromURL(ctx, client, url, name, defaultChunkSize)
+}
+
+// NewFromURLWithChunkSize is like NewFromURL but allows the Range request
+// and cache chunk size to be set explicitly, in bytes.
+func NewFromURLWithChunkSize(ctx context.Context, client *http.Client, url, name string, chunkSize int) (vfs.FileSystem, error) {
+	return newFromURL(ctx, client, url, name, chunkSize)
+}
+
+func newFromURL(ctx context.Context, client *http.Client, url, name string, chunkSize int) (vfs.FileSystem, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	size, err := headContentLength(ctx, client, url)
+	if err != nil {
+		return nil, err
+	}
+	ra := &rangeReaderAt{
+		ctx:       ctx,
+		client:    client,
+		url:       url,
+		size:      size,
+		chunkSize: int64(chunkSize),
+		cache:     newLRUChunkCache(defaultCacheChunks),
+	}
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return nil, fmt.Errorf("zipfs: parsing remote zip at %s: %v", url, err)
+	}
+	return New(&zip.ReadCloser{Reader: *zr}, name), nil
+}
+
+// headContentLength issues a HEAD request for url and returns its size,
+// failing if the server does not advertise support for byte ranges.
+func headContentLength(ctx context.Context, client *http.Client, url string) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("zipfs: HEAD %s: %v", url, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("zipfs: HEAD %s: unexpected status %s", url, resp.Status)
+	}
+	if resp.Header.Get("Accept-Ranges") != "bytes" {
+		return 0, fmt.Errorf("zipfs: %s does not advertise Accept-Ranges: bytes", url)
+	}
+	if resp.ContentLength < 0 {
+		return 0, fmt.Errorf("zipfs: %s did not return a Content-Length", url)
+	}
+	return resp.ContentLength, nil
+}
+
+// rangeReaderAt is an io.ReaderAt backed by HTTP Range requests against a
+// single URL, with reads grouped into fixed-size chunks kept in an LRU
+// cache so that the many small reads a zip.Reader issues don't each cost a
+// round trip.
+type rangeReaderAt struct {
+	ctx       context.Context
+	client    *http.Client
+	url       string
+	size      int64
+	chunkSize int64
+
+	mu    sync.Mutex
+	cache *lruChunkCache
+}
+
+func (r *rangeReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 || off >= r.size {
+		return 0, fmt.Errorf("zipfs: ReadAt offset %d out of range [0,%d)", off, r.size)
+	}
+	n := 0
+	for n < len(p) {
+		readOff := off + int64(n)
+		if readOff >= r.size {
+			break
+		}
+		idx := readOff / r.chunkSize
+		chunk, err := r.chunk(idx)
+		if err != nil {
+			return n, err
+		}
+		start := readOff - idx*r.chunkSize
+		copied := copy(p[n:], chunk[start:])
+		n += copied
+	}
+	if n < len(p) {
+		return n, fmt.Errorf("zipfs: short read at offset %d", off)
+	}
+	return n, nil
+}
+
+// chunk returns the bytes of the idx'th chunk of the remote file, fetching
+// it over HTTP on a cache miss.
+func (r *rangeReaderAt) chunk(idx int64) ([]byte, error) {
+	r.mu.Lock()
+	if data, ok := r.cache.get(idx); ok {
+		r.mu.Unlock()
+		return data, nil
+	}
+	r.mu.Unlock()
+
+	start := idx * r.chunkSize
+	end := start + r.chunkSize - 1
+	if end >= r.size {
+		end = r.size - 1
+	}
+	data, err := r.fetchRange(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.cache.add(idx, data)
+	r.mu.Unlock()
+	return data, nil
+}
+
+func (r *rangeReaderAt) fetchRange(start, end int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("zipfs: GET %s (range %d-%d): %v", r.url, start, end, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("zipfs: GET %s (range %d-%d): unexpected status %s", r.url, start, end, resp.Status)
+	}
+	want := end - start + 1
+	data := make([]byte, want)
+	if _, err := io.ReadFull(resp.Body, data); err != nil {
+		return nil, fmt.Errorf("zipfs: reading range %d-%d of %s: %v", start, end, r.url, err)
+	}
+	return data, nil
+}
+
+// lruChunkCache is a fixed-capacity, least-recently-used cache of zip file
+// chunks keyed by chunk index.
+type lruChunkCache struct {
+	capacity int
+	ll       *list.List
+	items    map[int64]*list.Element
+}
+
+type chunkCacheEntry struct {
+	idx  int64
+	data []byte
+}
+
+func newLRUChunkCache(capacity int) *lruChunkCache {
+	return &lruChunkCache{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[int64]*list.Element),
+	}
+}
+
+func (c *lruChunkCache) get(idx int64) ([]byte, bool) {
+	e, ok := c.items[idx]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return e.Value.(*chunkCacheEntry).data, true
+}
+
+func (c *lruChunkCache) add(idx int64, data []byte) {
+	if e, ok := c.items[idx]; ok {
+		e.Value.(*chunkCacheEntry).data = data
+		c.ll.MoveToFront(e)
+		return
+	}
+	e := c.ll.PushFront(&chunkCacheEntry{idx: idx, data: data})
+	c.items[idx] = e
+	for c.ll.Len() > c.capacity {
+		oldest := c.ll.Back()
+		if oldest == nil {
+			break
+		}
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*chunkCacheEntry).idx)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zipfs
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// rangeServer serves data over HTTP, honoring Range requests and requiring
+// them, as NewFromURL does.
+func rangeServer(t *testing.T, data []byte) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Accept-Ranges", "bytes")
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			return
+		}
+		rng := r.Header.Get("Range")
+		if !strings.HasPrefix(rng, "bytes=") {
+			http.Error(w, "range required", http.StatusBadRequest)
+			return
+		}
+		var start, end int
+		if _, err := fmt.Sscanf(rng, "bytes=%d-%d", &start, &end); err != nil {
+			http.Error(w, "bad range", http.StatusBadRequest)
+			return
+		}
+		if end >= len(data) {
+			end = len(data) - 1
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(data[start : end+1])
+	}))
+}
+
+func TestNewFromURL(t *testing.T) {
+	zipBytes := buildZip(t, map[string]string{"foo": "foo contents", "bar/baz": "baz contents"})
+
+	srv := rangeServer(t, zipBytes)
+	defer srv.Close()
+
+	fsys, err := NewFromURLWithChunkSize(context.Background(), srv.Client(), srv.URL, "test", 16)
+	if err != nil {
+		t.Fatalf("NewFromURL: %v", err)
+	}
+
+	f, err := fsys.Open("/foo")
+	if err != nil {
+		t.Fatalf("Open(/foo): %v", err)
+	}
+	got, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "foo contents" {
+		t.Errorf("contents = %q, want %q", got, "foo contents")
+	}
+
+	f2, err := fsys.Open("/bar/baz")
+	if err != nil {
+		t.Fatalf("Open(/bar/baz): %v", err)
+	}
+	got2, err := ioutil.ReadAll(f2)
+	f2.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got2) != "baz contents" {
+		t.Errorf("contents = %q, want %q", got2, "baz contents")
+	}
+}
+
+func TestNewFromURLNoRangeSupport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "10")
+		// no Accept-Ranges header
+	}))
+	defer srv.Close()
+
+	if _, err := NewFromURL(context.Background(), srv.Client(), srv.URL, "test"); err == nil {
+		t.Errorf("NewFromURL against a server without Accept-Ranges unexpectedly succeeded")
+	}
+}
+
+func TestLRUChunkCacheEviction(t *testing.T) {
+	c := newLRUChunkCache(2)
+	c.add(0, []byte("a"))
+	c.add(1, []byte("b"))
+
+	if _, ok := c.get(0); !ok {
+		t.Fatalf("chunk 0 missing before eviction")
+	}
+	// Touching 0 makes 1 the least recently used, so adding a third chunk
+	// should evict 1, not 0.
+	c.add(2, []byte("c"))
+
+	if _, ok := c.get(1); ok {
+		t.Errorf("chunk 1 should have been evicted")
+	}
+	if _, ok := c.get(0); !ok {
+		t.Errorf("chunk 0 should still be cached")
+	}
+	if _, ok := c.get(2); !ok {
+		t.Errorf("chunk 2 should be cached")
+	}
+}